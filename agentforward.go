@@ -0,0 +1,54 @@
+package gowebssh
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// EnableAgentForwarding 开启 ssh-agent 转发：sock 非空时转发至指定的本地 agent socket（如 $SSH_AUTH_SOCK），
+// 为空时使用内存 agent，密钥来自 messageTypePublickey 已解析的私钥，让浏览器用户像本地 ssh -A 一样跳转堡垒机
+func (ws *WebSSH) EnableAgentForwarding(sock string) {
+	ws.agentForwarding = true
+	ws.agentSock = sock
+}
+
+// setupAgentForwarding 建立 agent 转发，需在 session.Shell() 之前调用
+func (ws *WebSSH) setupAgentForwarding(session *ssh.Session) error {
+	var ag agent.Agent
+	if ws.agentSock != "" {
+		conn, err := net.Dial("unix", ws.agentSock)
+		if err != nil {
+			return errors.Wrap(err, "dial agent socket error")
+		}
+		ag = agent.NewClient(conn)
+	} else {
+		keyring := agent.NewKeyring()
+		for _, cred := range ws.publickeyCreds {
+			var rawKey interface{}
+			var err error
+			if cred.Passphrase != "" {
+				rawKey, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(cred.Pem), []byte(cred.Passphrase))
+			} else {
+				rawKey, err = ssh.ParseRawPrivateKey([]byte(cred.Pem))
+			}
+			if err != nil {
+				return errors.Wrap(err, "parse private key for agent error")
+			}
+			if err := keyring.Add(agent.AddedKey{PrivateKey: rawKey}); err != nil {
+				return errors.Wrap(err, "add key to in-memory agent error")
+			}
+		}
+		ag = keyring
+	}
+
+	if err := agent.ForwardToAgent(ws.sshClient, ag); err != nil {
+		return errors.Wrap(err, "forward to agent error")
+	}
+	if err := agent.RequestAgentForwarding(session); err != nil {
+		return errors.Wrap(err, "request agent forwarding error")
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package gowebssh
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// kbdInteractiveQuestion keyboard-interactive 质询中的单条 prompt
+type kbdInteractiveQuestion struct {
+	Prompt string `json:"prompt"`
+	Echo   bool   `json:"echo"`
+}
+
+// kbdInteractiveChallenge 服务端 -> 浏览器的 keyboard-interactive 质询内容
+type kbdInteractiveChallenge struct {
+	Name        string                   `json:"name"`
+	Instruction string                   `json:"instruction"`
+	Questions   []kbdInteractiveQuestion `json:"questions"`
+}
+
+// keyboardInteractiveChallenge 实现 ssh.KeyboardInteractiveChallenge：把质询转发给浏览器，
+// 阻塞等待 messageTypeKbdResponse 应答后返回，常用于 OTP/2FA 等多因子场景
+func (ws *WebSSH) keyboardInteractiveChallenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	qs := make([]kbdInteractiveQuestion, len(questions))
+	for i, q := range questions {
+		var echo bool
+		if i < len(echos) {
+			echo = echos[i]
+		}
+		qs[i] = kbdInteractiveQuestion{Prompt: q, Echo: echo}
+	}
+	data, err := json.Marshal(kbdInteractiveChallenge{Name: name, Instruction: instruction, Questions: qs})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal keyboard-interactive challenge error")
+	}
+
+	// websocket 连接只允许单个 goroutine 并发写入，质询通过 channel 交给 server() 的主循环代为写出
+	ws.kbdChallenges <- data
+
+	answers, ok := <-ws.kbdAnswers
+	if !ok {
+		return nil, errors.New("keyboard-interactive channel closed")
+	}
+	return answers, nil
+}
+
+// publickeyCredential 浏览器提交的单个私钥凭据，支持带密码保护的私钥
+type publickeyCredential struct {
+	Pem        string `json:"pem"`
+	Passphrase string `json:"passphrase"`
+}
+
+// parsePublickeyCredentials 解析浏览器提交的一组私钥凭据，支持单次提交多把私钥
+func parsePublickeyCredentials(raw []byte) ([]publickeyCredential, error) {
+	var creds []publickeyCredential
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return nil, errors.Wrap(err, "parse publickey credentials error")
+	}
+	if len(creds) == 0 {
+		return nil, errors.New("no private key provided")
+	}
+	return creds, nil
+}
+
+// signersFromCredentials 把私钥凭据解析为 ssh.Signer，用于 ssh.PublicKeys 认证方式
+func signersFromCredentials(creds []publickeyCredential) ([]ssh.Signer, error) {
+	signers := make([]ssh.Signer, 0, len(creds))
+	for _, c := range creds {
+		var signer ssh.Signer
+		var err error
+		if c.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(c.Pem), []byte(c.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(c.Pem))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parse private key error")
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// authResult 后台 goroutine 完成 ssh 握手与会话建立后的结果
+type authResult struct {
+	session *ssh.Session
+	err     error
+	errMsg  string
+	method  string
+}
+
+// combinedAuthMethod 根据本次握手实际合并了哪些凭据，给出上报给 metrics/hooks 及
+// 失败时回显给浏览器的认证方式标签
+func combinedAuthMethod(gotPassword, gotPublickey bool) string {
+	switch {
+	case gotPassword && gotPublickey:
+		return "password+publickey"
+	case gotPublickey:
+		return "publickey"
+	default:
+		return "password"
+	}
+}
+
+// dialSSHSession 在独立 goroutine 中完成 ssh 握手与 pty 会话建立，
+// 使 keyboard-interactive 回调阻塞等待应答时不会卡住 websocket 读取循环
+func (ws *WebSSH) dialSSHSession(config ssh.ClientConfig, msg message, method, errMsg string, result chan<- authResult) {
+	session, err := ws.newSSHXtermSession(ws.sshConn, &config, msg)
+	result <- authResult{session: session, err: err, errMsg: errMsg, method: method}
+}
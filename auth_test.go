@@ -0,0 +1,24 @@
+package gowebssh
+
+import "testing"
+
+func TestCombinedAuthMethod(t *testing.T) {
+	cases := []struct {
+		name                      string
+		gotPassword, gotPublickey bool
+		want                      string
+	}{
+		{"password only", true, false, "password"},
+		{"publickey only", false, true, "publickey"},
+		{"both", true, true, "password+publickey"},
+		{"neither", false, false, "password"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := combinedAuthMethod(tc.gotPassword, tc.gotPublickey); got != tc.want {
+				t.Fatalf("combinedAuthMethod(%v, %v) = %q, want %q", tc.gotPassword, tc.gotPublickey, got, tc.want)
+			}
+		})
+	}
+}
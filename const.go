@@ -0,0 +1,21 @@
+package gowebssh
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// 默认配置
+const (
+	DefaultBuffSize    uint32        = 1024
+	DefaultTerm        string        = "xterm"
+	DefaultConnTimeout time.Duration = 10 * time.Second
+)
+
+// authCombineWindow 收到 password 或 publickey 凭据后等待的合并窗口：窗口内到达的另一种
+// 凭据会合并进同一次 ssh 握手，用于支持服务端要求 publickey+password 同时满足的多因子登录
+const authCombineWindow = 150 * time.Millisecond
+
+// DefaultLogger 默认日志输出到标准输出
+var DefaultLogger = log.New(os.Stdout, "", log.LstdFlags)
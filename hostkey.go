@@ -0,0 +1,68 @@
+package gowebssh
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SetHostKeyCallback 设置自定义的 host key 校验回调，覆盖默认的 TOFU 确认流程
+func (ws *WebSSH) SetHostKeyCallback(cb ssh.HostKeyCallback) {
+	ws.hostKeyCallback = cb
+}
+
+// SetKnownHostsFile 使用 known_hosts 文件校验远程主机公钥
+func (ws *WebSSH) SetKnownHostsFile(path string) error {
+	cb, err := knownhosts.New(path)
+	if err != nil {
+		return errors.Wrap(err, "load known_hosts file error")
+	}
+	ws.hostKeyCallback = cb
+	return nil
+}
+
+// SetHostKeyFingerprints 按连接地址校验远程主机公钥的 SHA256 指纹
+func (ws *WebSSH) SetHostKeyFingerprints(fingerprints map[string]string) {
+	ws.hostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		want, ok := fingerprints[remote.String()]
+		if !ok {
+			return errors.Errorf("no fingerprint configured for %s", remote.String())
+		}
+		if got := fingerprintSHA256(key); got != want {
+			return errors.Errorf("host key fingerprint mismatch for %s: got %s, want %s", remote.String(), got, want)
+		}
+		return nil
+	}
+}
+
+// fingerprintSHA256 计算公钥的 SHA256 指纹，格式与 ssh-keygen -lf 一致
+func fingerprintSHA256(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// tofuHostKeyCallback 未配置校验方式时的默认行为：把指纹发给浏览器，等待用户确认。
+// 本回调在 dialSSHSession/dialThroughJumpHosts 的后台 goroutine 中被 ssh 库同步调用，
+// 不能直接 ws.websocket.ReadJSON/WriteJSON，否则会和 server() 主循环及其 websocket 读 goroutine
+// 并发读写同一个连接（gorilla/websocket 不支持）；这里改为走 hostKeyChallenges/hostKeyConfirm
+// 这对 channel，与 keyboard-interactive 质询（见 auth.go 的 kbdChallenges/kbdAnswers）同一种桥接方式
+func (ws *WebSSH) tofuHostKeyCallback(_ string, remote net.Addr, key ssh.PublicKey) error {
+	fp := fingerprintSHA256(key)
+	data := fmt.Sprintf("%s %s", remote.String(), fp)
+
+	ws.hostKeyChallenges <- []byte(data)
+
+	accept, ok := <-ws.hostKeyConfirm
+	if !ok {
+		return errors.New("host key confirm channel closed")
+	}
+	if !accept {
+		return errors.Errorf("host key rejected for %s", remote.String())
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package gowebssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFingerprintSHA256(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key error: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey error: %v", err)
+	}
+
+	got := fingerprintSHA256(sshPub)
+	if !strings.HasPrefix(got, "SHA256:") {
+		t.Fatalf("expected fingerprint prefixed with SHA256:, got %q", got)
+	}
+	if strings.Contains(got, "=") {
+		t.Fatalf("expected unpadded (RawStdEncoding) base64, got %q", got)
+	}
+	if again := fingerprintSHA256(sshPub); again != got {
+		t.Fatalf("expected fingerprint to be deterministic, got %q then %q", got, again)
+	}
+
+	pub2, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key error: %v", err)
+	}
+	sshPub2, err := ssh.NewPublicKey(pub2)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey error: %v", err)
+	}
+	if other := fingerprintSHA256(sshPub2); other == got {
+		t.Fatalf("expected different keys to produce different fingerprints")
+	}
+}
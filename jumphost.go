@@ -0,0 +1,81 @@
+package gowebssh
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// JumpHostConfig 描述一跳 ProxyJump 跳板机的连接信息
+type JumpHostConfig struct {
+	Addr            string
+	User            string
+	Password        string
+	Signers         []ssh.Signer
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// SetJumpHosts 设置一组跳板机，messageTypeAddr 的出站连接将依次经过这些跳板机中转后再到达目标地址，
+// 效果等同于 ssh -J user1@jump1,user2@jump2 target
+func (ws *WebSSH) SetJumpHosts(hosts []JumpHostConfig) {
+	ws.jumpHosts = hosts
+}
+
+// dialThroughJumpHosts 依次连接各跳板机，并从最后一跳拨号到最终目标地址；
+// 中途某一跳失败时，已经建立的前几跳连接会被关闭后再返回错误，不泄漏给调用方
+func (ws *WebSSH) dialThroughJumpHosts(addr string) (net.Conn, error) {
+	var client *ssh.Client
+	startIdx := len(ws.jumpClients)
+	closeEstablishedHops := func() {
+		for _, c := range ws.jumpClients[startIdx:] {
+			_ = c.Close()
+		}
+		ws.jumpClients = ws.jumpClients[:startIdx]
+	}
+
+	for _, hop := range ws.jumpHosts {
+		var auth []ssh.AuthMethod
+		if hop.Password != "" {
+			auth = append(auth, ssh.Password(hop.Password))
+		}
+		if len(hop.Signers) > 0 {
+			auth = append(auth, ssh.PublicKeys(hop.Signers...))
+		}
+
+		hostKeyCallback := hop.HostKeyCallback
+		if hostKeyCallback == nil {
+			hostKeyCallback = ws.hostKeyCallback
+		}
+		if hostKeyCallback == nil {
+			hostKeyCallback = ws.tofuHostKeyCallback
+		}
+
+		var conn net.Conn
+		var err error
+		if client == nil {
+			conn, err = net.Dial("tcp", hop.Addr)
+		} else {
+			conn, err = client.Dial("tcp", hop.Addr)
+		}
+		if err != nil {
+			closeEstablishedHops()
+			return nil, errors.Wrap(err, "dial jump host "+hop.Addr+" error")
+		}
+
+		c, chans, reqs, err := ssh.NewClientConn(conn, hop.Addr, &ssh.ClientConfig{
+			User:            hop.User,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         ws.connTimeout,
+		})
+		if err != nil {
+			closeEstablishedHops()
+			return nil, errors.Wrap(err, "connect jump host "+hop.Addr+" error")
+		}
+
+		client = ssh.NewClient(c, chans, reqs)
+		ws.jumpClients = append(ws.jumpClients, client)
+	}
+	return client.Dial("tcp", addr)
+}
@@ -0,0 +1,54 @@
+package gowebssh
+
+// messageType 定义 websocket 消息类型
+type messageType string
+
+// 前端与后端交互的消息类型
+const (
+	messageTypeAddr      messageType = "addr"
+	messageTypeTerm      messageType = "term"
+	messageTypeLogin     messageType = "login"
+	messageTypePassword  messageType = "password"
+	messageTypePublickey messageType = "publickey"
+	messageTypeStdin     messageType = "stdin"
+	messageTypeStdout    messageType = "stdout"
+	messageTypeStderr    messageType = "stderr"
+	messageTypeResize    messageType = "resize"
+
+	// messageTypeHostKey 服务端 -> 浏览器，首次连接时携带远程主机公钥指纹
+	messageTypeHostKey messageType = "hostkey"
+	// messageTypeHostKeyConfirm 浏览器 -> 服务端，确认是否信任该主机公钥
+	messageTypeHostKeyConfirm messageType = "hostkeyConfirm"
+
+	// messageTypeKbdInteractive 服务端 -> 浏览器，keyboard-interactive 质询（OTP/2FA/PAM 等）
+	messageTypeKbdInteractive messageType = "kbdInteractive"
+	// messageTypeKbdResponse 浏览器 -> 服务端，keyboard-interactive 质询的应答
+	messageTypeKbdResponse messageType = "kbdResponse"
+
+	// messageTypeGuardPrompt 服务端 -> 浏览器，命中 GuardWarn 的命令行，等待用户二次确认
+	messageTypeGuardPrompt messageType = "guardPrompt"
+	// messageTypeGuardConfirm 浏览器 -> 服务端，对 messageTypeGuardPrompt 的确认结果，Data 为 "allow" 或其它值（视为拒绝）
+	messageTypeGuardConfirm messageType = "guardConfirm"
+
+	// sftp 相关消息类型，浏览器 <-> 服务端，Data 为 JSON 编码的请求/响应体；
+	// 例外是 messageTypeSftpDownloadData，其 Data 为文件原始字节分片，Data 为空的一条表示下载结束
+	messageTypeSftpList         messageType = "sftpList"
+	messageTypeSftpStat         messageType = "sftpStat"
+	messageTypeSftpMkdir        messageType = "sftpMkdir"
+	messageTypeSftpRm           messageType = "sftpRm"
+	messageTypeSftpRename       messageType = "sftpRename"
+	messageTypeSftpUploadInit   messageType = "sftpUploadInit"
+	messageTypeSftpUploadChunk  messageType = "sftpUploadChunk"
+	messageTypeSftpUploadEnd    messageType = "sftpUploadEnd"
+	messageTypeSftpDownloadReq  messageType = "sftpDownloadReq"
+	messageTypeSftpDownloadData messageType = "sftpDownloadData"
+	messageTypeSftpProgress     messageType = "sftpProgress"
+)
+
+// message websocket 通信的消息结构
+type message struct {
+	Type messageType `json:"type"`
+	Data []byte      `json:"data"`
+	Cols int         `json:"cols"`
+	Rows int         `json:"rows"`
+}
@@ -0,0 +1,51 @@
+package gowebssh
+
+import "time"
+
+// Metrics 是可插拔的指标上报接口，默认使用不做任何上报的实现；
+// 基于 prometheus/client_golang 的实现见子包 github.com/staugur/gowebssh/prometheus
+type Metrics interface {
+	// IncConnect 在一个 websocket 连接建立时调用
+	IncConnect()
+	// IncAuthFailure 在 ssh 认证失败时调用，method 为 "password"、"publickey" 等
+	IncAuthFailure(method string)
+	// ObserveSessionDuration 在连接结束时调用，记录本次会话的持续时间
+	ObserveSessionDuration(d time.Duration)
+	// AddBytesIn 记录浏览器发来的字节数：stdin 输入及 sftp 上传写入的数据
+	AddBytesIn(n int64)
+	// AddBytesOut 记录发往浏览器的字节数：ssh stdout/stderr 输出及 sftp 下载的数据
+	AddBytesOut(n int64)
+}
+
+// noopMetrics 是 Metrics 的默认空实现
+type noopMetrics struct{}
+
+func (noopMetrics) IncConnect()                          {}
+func (noopMetrics) IncAuthFailure(method string)         {}
+func (noopMetrics) ObserveSessionDuration(d time.Duration) {}
+func (noopMetrics) AddBytesIn(n int64)                   {}
+func (noopMetrics) AddBytesOut(n int64)                  {}
+
+// Hooks 是连接生命周期的回调集合，字段为空的回调不会被调用
+type Hooks struct {
+	// OnConnect 在 websocket 连接建立、server() 开始处理时调用
+	OnConnect func(id string)
+	// OnAuth 在每次 ssh 认证尝试完成后调用
+	OnAuth func(id string, method string, success bool)
+	// OnDisconnect 在连接结束时调用，携带本次会话的持续时间
+	OnDisconnect func(id string, duration time.Duration)
+	// OnResize 在终端窗口大小变化时调用
+	OnResize func(id string, cols, rows int)
+	// OnData 在 stdin、stdout/stderr 及 sftp 上传/下载数据转发时调用，direction 为 "in" 或 "out"
+	OnData func(id string, direction string, n int)
+}
+
+// SetMetrics 设置指标上报实现，不设置时默认不上报
+func (ws *WebSSH) SetMetrics(m Metrics) {
+	ws.metrics = m
+}
+
+// SetHooks 设置连接生命周期回调
+func (ws *WebSSH) SetHooks(h Hooks) {
+	ws.hooks = h
+}
@@ -0,0 +1,72 @@
+// Package prometheus 提供 gowebssh.Metrics 的 Prometheus 实现，
+// 把连接数、认证失败次数、会话时长、吞吐量注册为 prometheus.Registry 下的指标
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics 实现 gowebssh.Metrics 接口
+type Metrics struct {
+	connectTotal     prometheus.Counter
+	authFailureTotal *prometheus.CounterVec
+	sessionDuration  prometheus.Histogram
+	bytesIn          prometheus.Counter
+	bytesOut         prometheus.Counter
+}
+
+// New 创建 Metrics 并把所有 collector 注册到 reg
+func New(reg *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		connectTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gowebssh_connect_total",
+			Help: "Total number of established websocket connections.",
+		}),
+		authFailureTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gowebssh_auth_failure_total",
+			Help: "Total number of failed ssh authentication attempts, by method.",
+		}, []string{"method"}),
+		sessionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "gowebssh_session_duration_seconds",
+			Help:    "Duration of ssh sessions in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		bytesIn: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gowebssh_bytes_in_total",
+			Help: "Total number of bytes received from the browser (ssh stdin input and sftp uploads).",
+		}),
+		bytesOut: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gowebssh_bytes_out_total",
+			Help: "Total number of bytes sent to the browser (ssh stdout/stderr output and sftp downloads).",
+		}),
+	}
+	reg.MustRegister(m.connectTotal, m.authFailureTotal, m.sessionDuration, m.bytesIn, m.bytesOut)
+	return m
+}
+
+// IncConnect 见 gowebssh.Metrics
+func (m *Metrics) IncConnect() {
+	m.connectTotal.Inc()
+}
+
+// IncAuthFailure 见 gowebssh.Metrics
+func (m *Metrics) IncAuthFailure(method string) {
+	m.authFailureTotal.WithLabelValues(method).Inc()
+}
+
+// ObserveSessionDuration 见 gowebssh.Metrics
+func (m *Metrics) ObserveSessionDuration(d time.Duration) {
+	m.sessionDuration.Observe(d.Seconds())
+}
+
+// AddBytesIn 见 gowebssh.Metrics
+func (m *Metrics) AddBytesIn(n int64) {
+	m.bytesIn.Add(float64(n))
+}
+
+// AddBytesOut 见 gowebssh.Metrics
+func (m *Metrics) AddBytesOut(n int64) {
+	m.bytesOut.Add(float64(n))
+}
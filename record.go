@@ -0,0 +1,120 @@
+package gowebssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RecordFormat 录像写入格式
+type RecordFormat int
+
+const (
+	// RecordFormatAsciicast 以 asciicast v2 格式记录（默认）
+	RecordFormatAsciicast RecordFormat = iota
+	// RecordFormatRaw 只记录原始字节，不附带时间戳和事件类型
+	RecordFormatRaw
+)
+
+// recorder 把一次会话的输入输出事件写入录像 sink
+type recorder struct {
+	mu            sync.Mutex
+	w             io.WriteCloser
+	format        RecordFormat
+	start         time.Time
+	term          string
+	headerWritten bool
+}
+
+// asciicastHeader asciicast v2 格式的首行头部
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env"`
+}
+
+// EnableRecording 为当前连接开启会话录像，字节流写入 w。asciicast 头部此时尚不知道
+// 协商出的真实终端尺寸，要等 PTY 建立后 setSize 被调用才会写出；若会话结束前始终没有
+// 协商出尺寸（如立即出错断开），首个事件写入时会以 80x40 兜底
+func (ws *WebSSH) EnableRecording(w io.WriteCloser) {
+	ws.recorder = &recorder{w: w, format: ws.recordFormat, start: time.Now(), term: ws.term}
+}
+
+// setSize 在 PTY 尺寸协商完成后写出 asciicast 头部，重复调用或头部已写出时不做任何事
+func (r *recorder) setSize(cols, rows int) {
+	if r == nil || r.format != RecordFormatAsciicast {
+		return
+	}
+	r.writeHeader(cols, rows)
+}
+
+// writeHeader 写出 asciicast v2 的首行头部，只会真正写出一次
+func (r *recorder) writeHeader(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.headerWritten {
+		return
+	}
+	r.headerWritten = true
+	header, err := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: r.start.Unix(),
+		Env:       map[string]string{"TERM": r.term},
+	})
+	if err == nil {
+		_, _ = r.w.Write(append(header, '\n'))
+	}
+}
+
+// SetRecordFormat 设置录像写入格式，需在 EnableRecording 之前调用
+func (ws *WebSSH) SetRecordFormat(format RecordFormat) {
+	ws.recordFormat = format
+}
+
+// SetRecorderFactory 设置按连接 id 生成录像 sink 的工厂函数，每个连接建立时自动开启录像
+func (ws *WebSSH) SetRecorderFactory(factory func(id string) io.WriteCloser) {
+	ws.recorderFactory = factory
+}
+
+// writeEvent 写入一条 stdout/stdin 记录
+func (r *recorder) writeEvent(code, data string) {
+	if r == nil {
+		return
+	}
+	if r.format == RecordFormatAsciicast {
+		r.writeHeader(80, 40) // setSize 会在真实尺寸协商出来后抢先写出头部，此处仅为兜底
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.format == RecordFormatRaw {
+		_, _ = r.w.Write([]byte(data))
+		return
+	}
+	out, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), code, data})
+	if err != nil {
+		return
+	}
+	_, _ = r.w.Write(append(out, '\n'))
+}
+
+// recordResize 写入一条窗口大小变化记录，RecordFormatRaw 下不记录
+func (r *recorder) recordResize(cols, rows int) {
+	if r == nil || r.format == RecordFormatRaw {
+		return
+	}
+	r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// close 关闭录像 sink
+func (r *recorder) close() {
+	if r == nil {
+		return
+	}
+	_ = r.w.Close()
+}
@@ -0,0 +1,77 @@
+package gowebssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func firstLine(buf *bytes.Buffer) []byte {
+	return bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0]
+}
+
+func TestEnableRecordingWritesNegotiatedSize(t *testing.T) {
+	ws := NewWebSSH()
+	ws.SetTerm("xterm-256color")
+	var buf bytes.Buffer
+	ws.EnableRecording(nopWriteCloser{&buf})
+
+	ws.recorder.setSize(120, 40)
+	ws.recorder.writeEvent("o", "hello")
+
+	lines := bytes.Split(bytes.TrimRight(buf.Bytes(), "\n"), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected a header line and 1 event line, got %d lines: %q", len(lines), buf.String())
+	}
+
+	var header asciicastHeader
+	if err := json.Unmarshal(lines[0], &header); err != nil {
+		t.Fatalf("unmarshal header error: %v", err)
+	}
+	if header.Width != 120 || header.Height != 40 {
+		t.Fatalf("expected negotiated size 120x40 in header, got %dx%d", header.Width, header.Height)
+	}
+	if header.Env["TERM"] != "xterm-256color" {
+		t.Fatalf("expected TERM env to match ws.term, got %q", header.Env["TERM"])
+	}
+}
+
+func TestEnableRecordingFallsBackToDefaultSize(t *testing.T) {
+	ws := NewWebSSH()
+	var buf bytes.Buffer
+	ws.EnableRecording(nopWriteCloser{&buf})
+
+	// 会话结束前始终没有协商出真实尺寸时，首次写事件应以 80x40 兜底，而不是阻塞或崩溃
+	ws.recorder.writeEvent("o", "hello")
+
+	var header asciicastHeader
+	if err := json.Unmarshal(firstLine(&buf), &header); err != nil {
+		t.Fatalf("unmarshal header error: %v", err)
+	}
+	if header.Width != 80 || header.Height != 40 {
+		t.Fatalf("expected fallback size 80x40, got %dx%d", header.Width, header.Height)
+	}
+}
+
+func TestRecorderSetSizeWritesHeaderOnlyOnce(t *testing.T) {
+	ws := NewWebSSH()
+	var buf bytes.Buffer
+	ws.EnableRecording(nopWriteCloser{&buf})
+
+	ws.recorder.setSize(100, 30)
+	ws.recorder.setSize(200, 60) // 重复调用不应覆盖已经写出的头部
+
+	var header asciicastHeader
+	if err := json.Unmarshal(firstLine(&buf), &header); err != nil {
+		t.Fatalf("unmarshal header error: %v", err)
+	}
+	if header.Width != 100 || header.Height != 30 {
+		t.Fatalf("expected the first setSize call to win, got %dx%d", header.Width, header.Height)
+	}
+}
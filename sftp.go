@@ -0,0 +1,296 @@
+package gowebssh
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+)
+
+// SetMaxUploadSize 限制单个文件上传的最大字节数，0 表示不限制
+func (ws *WebSSH) SetMaxUploadSize(n int64) {
+	ws.maxUploadSize = n
+}
+
+// SetSftpConcurrency 设置 sftp 客户端单文件的并发请求数
+func (ws *WebSSH) SetSftpConcurrency(n int) {
+	ws.sftpConcurrency = n
+}
+
+// sftpEntry 目录列表中的单个条目
+type sftpEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	ModTime int64  `json:"modTime"`
+	IsDir   bool   `json:"isDir"`
+}
+
+type sftpPathReq struct {
+	Path string `json:"path"`
+}
+
+type sftpRenameReq struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type sftpUploadInitReq struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type sftpUploadInitResp struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+type sftpUploadChunkReq struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+type sftpUploadEndReq struct {
+	ID string `json:"id"`
+}
+
+type sftpProgress struct {
+	ID    string `json:"id"`
+	Sent  int64  `json:"sent"`
+	Total int64  `json:"total"`
+}
+
+// newSftpClient 基于已建立的 ssh.Client 惰性创建 sftp 客户端
+func (ws *WebSSH) newSftpClient() error {
+	if ws.sftpClient != nil {
+		return nil
+	}
+	opts := make([]sftp.ClientOption, 0, 1)
+	if ws.sftpConcurrency > 0 {
+		opts = append(opts, sftp.MaxConcurrentRequestsPerFile(ws.sftpConcurrency))
+	}
+	client, err := sftp.NewClient(ws.sshClient, opts...)
+	if err != nil {
+		return errors.Wrap(err, "open sftp client error")
+	}
+	ws.sftpClient = client
+	ws.uploads = make(map[string]*sftp.File)
+	ws.uploadWritten = make(map[string]int64)
+	return nil
+}
+
+// handleSftp 按消息类型分发 sftp 操作，响应通过 websocket 回传
+func (ws *WebSSH) handleSftp(msg message) error {
+	switch msg.Type {
+	case messageTypeSftpList:
+		var req sftpPathReq
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return errors.Wrap(err, "parse sftp list request error")
+		}
+		infos, err := ws.sftpClient.ReadDir(req.Path)
+		if err != nil {
+			return errors.Wrap(err, "sftp readdir error")
+		}
+		entries := make([]sftpEntry, 0, len(infos))
+		for _, info := range infos {
+			entries = append(entries, sftpEntry{
+				Name:    info.Name(),
+				Size:    info.Size(),
+				Mode:    info.Mode().String(),
+				ModTime: info.ModTime().Unix(),
+				IsDir:   info.IsDir(),
+			})
+		}
+		return ws.writeSftpJSON(messageTypeSftpList, entries)
+
+	case messageTypeSftpStat:
+		var req sftpPathReq
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return errors.Wrap(err, "parse sftp stat request error")
+		}
+		info, err := ws.sftpClient.Stat(req.Path)
+		if err != nil {
+			return errors.Wrap(err, "sftp stat error")
+		}
+		return ws.writeSftpJSON(messageTypeSftpStat, sftpEntry{
+			Name:    info.Name(),
+			Size:    info.Size(),
+			Mode:    info.Mode().String(),
+			ModTime: info.ModTime().Unix(),
+			IsDir:   info.IsDir(),
+		})
+
+	case messageTypeSftpMkdir:
+		var req sftpPathReq
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return errors.Wrap(err, "parse sftp mkdir request error")
+		}
+		if err := ws.sftpClient.MkdirAll(req.Path); err != nil {
+			return errors.Wrap(err, "sftp mkdir error")
+		}
+
+	case messageTypeSftpRm:
+		var req sftpPathReq
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return errors.Wrap(err, "parse sftp rm request error")
+		}
+		if err := ws.sftpClient.Remove(req.Path); err != nil {
+			return errors.Wrap(err, "sftp rm error")
+		}
+
+	case messageTypeSftpRename:
+		var req sftpRenameReq
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return errors.Wrap(err, "parse sftp rename request error")
+		}
+		if err := ws.sftpClient.Rename(req.Old, req.New); err != nil {
+			return errors.Wrap(err, "sftp rename error")
+		}
+
+	case messageTypeSftpUploadInit:
+		return ws.sftpUploadInit(msg.Data)
+
+	case messageTypeSftpUploadChunk:
+		return ws.sftpUploadChunk(msg.Data)
+
+	case messageTypeSftpUploadEnd:
+		return ws.sftpUploadEnd(msg.Data)
+
+	case messageTypeSftpDownloadReq:
+		return ws.sftpDownload(msg.Data)
+	}
+	return nil
+}
+
+// sftpUploadInit 打开（或续传）目标文件，返回已写入的偏移量供客户端续传
+func (ws *WebSSH) sftpUploadInit(data []byte) error {
+	var req sftpUploadInitReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errors.Wrap(err, "parse sftp upload init request error")
+	}
+	if ws.maxUploadSize > 0 && req.Size > ws.maxUploadSize {
+		return errors.Errorf("upload size %d exceeds limit %d", req.Size, ws.maxUploadSize)
+	}
+
+	var offset int64
+	if info, err := ws.sftpClient.Stat(req.Path); err == nil {
+		offset = info.Size()
+	}
+
+	file, err := ws.sftpClient.OpenFile(req.Path, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return errors.Wrap(err, "sftp open file error")
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "sftp seek file error")
+	}
+	ws.uploads[req.ID] = file
+	ws.uploadWritten[req.ID] = offset
+
+	return ws.writeSftpJSON(messageTypeSftpUploadInit, sftpUploadInitResp{ID: req.ID, Offset: offset})
+}
+
+// sftpUploadChunk 写入一段上传数据并回传进度；累计写入字节数按 SetMaxUploadSize 强制校验，
+// 不信任客户端在 sftpUploadInit 中声明的 Size（客户端可以少报 Size 或不断追加分片绕过限制）
+func (ws *WebSSH) sftpUploadChunk(data []byte) error {
+	var req sftpUploadChunkReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errors.Wrap(err, "parse sftp upload chunk request error")
+	}
+	file, ok := ws.uploads[req.ID]
+	if !ok {
+		return errors.Errorf("unknown upload id %s", req.ID)
+	}
+	if ws.maxUploadSize > 0 && ws.uploadWritten[req.ID]+int64(len(req.Data)) > ws.maxUploadSize {
+		delete(ws.uploads, req.ID)
+		delete(ws.uploadWritten, req.ID)
+		_ = file.Close()
+		return errors.Errorf("upload %s exceeds size limit %d", req.ID, ws.maxUploadSize)
+	}
+	n, err := file.WriteAt(req.Data, req.Offset)
+	if err != nil {
+		return errors.Wrap(err, "sftp write chunk error")
+	}
+	ws.uploadWritten[req.ID] += int64(n)
+	ws.metrics.AddBytesIn(int64(n))
+	if ws.hooks.OnData != nil {
+		ws.hooks.OnData(ws.id, "in", n)
+	}
+	return ws.writeSftpJSON(messageTypeSftpProgress, sftpProgress{ID: req.ID, Sent: req.Offset + int64(n)})
+}
+
+// sftpUploadEnd 关闭上传文件句柄，结束一次上传
+func (ws *WebSSH) sftpUploadEnd(data []byte) error {
+	var req sftpUploadEndReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errors.Wrap(err, "parse sftp upload end request error")
+	}
+	file, ok := ws.uploads[req.ID]
+	if !ok {
+		return errors.Errorf("unknown upload id %s", req.ID)
+	}
+	delete(ws.uploads, req.ID)
+	delete(ws.uploadWritten, req.ID)
+	if err := file.Close(); err != nil {
+		return errors.Wrap(err, "sftp close upload file error")
+	}
+	return nil
+}
+
+// sftpDownload 读取远程文件并以分片消息流式回传给浏览器
+func (ws *WebSSH) sftpDownload(data []byte) error {
+	var req sftpPathReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		return errors.Wrap(err, "parse sftp download request error")
+	}
+	file, err := ws.sftpClient.Open(req.Path)
+	if err != nil {
+		return errors.Wrap(err, "sftp open for download error")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "sftp stat for download error")
+	}
+
+	buff := make([]byte, ws.buffSize)
+	var sent int64
+	for {
+		n, err := file.Read(buff)
+		if n > 0 {
+			if werr := ws.sendMessage(&message{Type: messageTypeSftpDownloadData, Data: buff[:n]}); werr != nil {
+				return errors.Wrap(werr, "send sftp download chunk error")
+			}
+			sent += int64(n)
+			ws.metrics.AddBytesOut(int64(n))
+			if ws.hooks.OnData != nil {
+				ws.hooks.OnData(ws.id, "out", n)
+			}
+			_ = ws.writeSftpJSON(messageTypeSftpProgress, sftpProgress{ID: req.Path, Sent: sent, Total: info.Size()})
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "sftp read for download error")
+		}
+	}
+	return ws.sendMessage(&message{Type: messageTypeSftpDownloadData})
+}
+
+// writeSftpJSON 将任意响应体序列化为 JSON 并通过指定消息类型发送
+func (ws *WebSSH) writeSftpJSON(t messageType, v interface{}) error {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal sftp response error")
+	}
+	return ws.sendMessage(&message{Type: t, Data: out})
+}
@@ -1,14 +1,17 @@
 package gowebssh
 
 import (
+	"encoding/json"
 	"io"
 	"log"
 	"net"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -18,9 +21,35 @@ type WebSSH struct {
 	buffSize uint32
 	term string
 	sshConn net.Conn
+	sshClient *ssh.Client
 	websocket *websocket.Conn
+	wsWriteMu sync.Mutex
 	connTimeout time.Duration
 	logger   *log.Logger
+	hostKeyCallback ssh.HostKeyCallback
+	sftpClient *sftp.Client
+	maxUploadSize int64
+	sftpConcurrency int
+	uploads map[string]*sftp.File
+	uploadWritten map[string]int64
+	recorder *recorder
+	recordFormat RecordFormat
+	recorderFactory func(id string) io.WriteCloser
+	kbdAnswers chan []string
+	kbdChallenges chan []byte
+	hostKeyChallenges chan []byte
+	hostKeyConfirm chan bool
+	jumpHosts []JumpHostConfig
+	jumpClients []*ssh.Client
+	agentForwarding bool
+	agentSock string
+	publickeyCreds []publickeyCredential
+	inputLimiter *tokenBucket
+	commandGuard func(line string) GuardAction
+	cmdLineBuf string
+	pendingGuard *pendingGuardLine
+	metrics Metrics
+	hooks Hooks
 }
 
 // WebSSH 构造函数
@@ -30,6 +59,7 @@ func NewWebSSH() *WebSSH {
 		logger:   DefaultLogger,
 		term: DefaultTerm,
 		connTimeout: DefaultConnTimeout,
+		metrics: noopMetrics{},
 	}
 }
 
@@ -77,14 +107,70 @@ func (ws *WebSSH) AddSSHConn(conn net.Conn) {
 	ws.sshConn = conn
 }
 
+// addrResult 后台 goroutine 拨通目标地址（或经由跳板机链路）后的结果
+type addrResult struct {
+	addr string
+	conn net.Conn
+	err  error
+}
+
+// dialAddr 在独立 goroutine 中拨号目标地址，使跳板机链路上默认的 TOFU 主机公钥确认
+// （tofuHostKeyCallback 阻塞等待 ws.hostKeyConfirm）不会卡住 websocket 读取循环，
+// 做法与 dialSSHSession 处理 ssh 握手认证一致
+func (ws *WebSSH) dialAddr(addr string, result chan<- addrResult) {
+	var conn net.Conn
+	var err error
+	if len(ws.jumpHosts) > 0 {
+		conn, err = ws.dialThroughJumpHosts(addr)
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	result <- addrResult{addr: addr, conn: conn, err: err}
+}
+
+// sendMessage 线程安全地向浏览器写入一条消息；websocket 连接只允许单个 goroutine 并发写入，
+// shell 输出、sftp 响应、host key/keyboard-interactive 质询等都必须经由此方法统一写出
+func (ws *WebSSH) sendMessage(msg *message) error {
+	ws.wsWriteMu.Lock()
+	defer ws.wsWriteMu.Unlock()
+	return ws.websocket.WriteJSON(msg)
+}
+
 // 处理 websocket 连接发送过来的数据
 func (ws *WebSSH) server() error {
+	connectedAt := time.Now()
+	ws.metrics.IncConnect()
+	if ws.hooks.OnConnect != nil {
+		ws.hooks.OnConnect(ws.id)
+	}
+	defer func() {
+		duration := time.Since(connectedAt)
+		ws.metrics.ObserveSessionDuration(duration)
+		if ws.hooks.OnDisconnect != nil {
+			ws.hooks.OnDisconnect(ws.id, duration)
+		}
+	}()
+
 	defer func(){
 		_ = ws.websocket.Close()
 	}()
+	defer func() {
+		if ws.sftpClient != nil {
+			_ = ws.sftpClient.Close()
+		}
+	}()
+	defer ws.recorder.close()
+
+	if ws.recorderFactory != nil && ws.recorder == nil {
+		ws.EnableRecording(ws.recorderFactory(ws.id))
+	}
 
+	hostKeyCallback := ws.hostKeyCallback
+	if hostKeyCallback == nil {
+		hostKeyCallback = ws.tofuHostKeyCallback
+	}
 	config := ssh.ClientConfig{
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 		Timeout:         ws.connTimeout,
 	}
 
@@ -94,31 +180,151 @@ func (ws *WebSSH) server() error {
 	var hasLogin bool
 	var hasAuth bool
 	var hasTerm bool
+	var addrInFlight bool
+	var authInFlight bool
+	var kbdAdded bool
+	var gotPassword, gotPublickey bool
+	var authMsg message
+	var authTimer *time.Timer
+	var authTimerC <-chan time.Time
+
+	// resetAuthTimer (重新)启动一个合并窗口：password/publickey 消息到达时调用，
+	// 若窗口内又收到另一种凭据，两者会合并进同一次 dialSSHSession 调用，
+	// 使服务端要求 publickey+password 同时生效的多因子登录得以通过这条路径。
+	// 两种凭据都已到齐时窗口传 0，不再等待，立即触发拨号
+	resetAuthTimer := func(window time.Duration) {
+		if authTimer != nil {
+			if !authTimer.Stop() {
+				select {
+				case <-authTimer.C:
+				default:
+				}
+			}
+		}
+		authTimer = time.NewTimer(window)
+		authTimerC = authTimer.C
+	}
+
+	ws.kbdAnswers = make(chan []string, 1)
+	ws.kbdChallenges = make(chan []byte, 1)
+	ws.hostKeyChallenges = make(chan []byte, 1)
+	ws.hostKeyConfirm = make(chan bool, 1)
+	authResultCh := make(chan authResult, 1)
+	addrResultCh := make(chan addrResult, 1)
+
+	msgCh := make(chan message)
+	readErrCh := make(chan error, 1)
+	go func() {
+		for {
+			var msg message
+			if err := ws.websocket.ReadJSON(&msg); err != nil {
+				readErrCh <- err
+				return
+			}
+			msgCh <- msg
+		}
+	}()
 
 	for {
 		var msg message
-		err := ws.websocket.ReadJSON(&msg)
-		if err != nil {
+		select {
+		case msg = <-msgCh:
+		case err := <-readErrCh:
 			return errors.Wrap(err, "websocket close or error message type")
+		case data := <-ws.kbdChallenges:
+			_ = ws.sendMessage(&message{Type: messageTypeKbdInteractive, Data: data})
+			continue
+		case data := <-ws.hostKeyChallenges:
+			_ = ws.sendMessage(&message{Type: messageTypeHostKey, Data: data})
+			continue
+		case result := <-addrResultCh:
+			addrInFlight = false
+			if result.err != nil {
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("connect error\r\n")})
+				return errors.Wrap(result.err, "connect addr "+result.addr+" error")
+			}
+			ws.AddSSHConn(result.conn)
+			defer func() {
+				_ = ws.sshConn.Close()
+			}()
+			defer func() {
+				for _, c := range ws.jumpClients {
+					_ = c.Close()
+				}
+			}()
+			hasAddr = true
+			continue
+		case <-authTimerC:
+			authTimer = nil
+			authTimerC = nil
+			authInFlight = true
+			method := combinedAuthMethod(gotPassword, gotPublickey)
+			go ws.dialSSHSession(config, authMsg, method, method+" login error", authResultCh)
+			continue
+		case result := <-authResultCh:
+			authInFlight = false
+			if result.err != nil {
+				ws.metrics.IncAuthFailure(result.method)
+				if ws.hooks.OnAuth != nil {
+					ws.hooks.OnAuth(ws.id, result.method, false)
+				}
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte(result.errMsg + "\r\n")})
+				return errors.Wrap(result.err, result.errMsg)
+			}
+			if ws.hooks.OnAuth != nil {
+				ws.hooks.OnAuth(ws.id, result.method, true)
+			}
+
+			session = result.session
+			defer func() {
+				_ = session.Close()
+			}()
+			defer func() {
+				_ = ws.sshClient.Close()
+			}()
+
+			var err error
+			stdin, err = session.StdinPipe()
+			if err != nil {
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("get stdin channel error\r\n")})
+				return errors.Wrap(err, "get stdin channel error")
+			}
+			defer func() {
+				_ = stdin.Close()
+			}()
+
+			err = ws.transformOutput(session, ws.websocket)
+			if err != nil {
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("get stdin & stderr channel error\r\n")})
+				return errors.Wrap(err, "get stdin & stderr channel error")
+			}
+
+			if ws.agentForwarding {
+				if err := ws.setupAgentForwarding(session); err != nil {
+					ws.logger.Printf("(%s) agent forwarding error: %v", ws.id, err)
+				}
+			}
+
+			err = session.Shell()
+			if err != nil {
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("start a login shell error\r\n")})
+				return errors.Wrap(err, "start a login shell error")
+			}
+
+			hasAuth = true
+			continue
 		}
 
+		var err error
 		switch msg.Type {
 		case messageTypeAddr:
-			if hasAddr {
+			if hasAddr || addrInFlight {
 				continue
 			}
 			addr, _ := url.QueryUnescape(string(msg.Data))
 			ws.logger.Printf("(%s) connect addr %s", ws.id, addr)
-			conn, err := net.Dial("tcp", addr)
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("connect error\r\n")})
-				return errors.Wrap(err, "connect addr " + addr + " error")
-			}
-			ws.AddSSHConn(conn)
-			defer func() {
-				_ = ws.sshConn.Close()
-			}()
-			hasAddr = true
+			addrInFlight = true
+			go ws.dialAddr(addr, addrResultCh)
 		case messageTypeTerm:
 			if hasTerm {
 				continue
@@ -135,7 +341,7 @@ func (ws *WebSSH) server() error {
 			ws.logger.Printf("(%s) login with user %s", ws.id, config.User)
 			hasLogin = true
 		case messageTypePassword:
-			if hasAuth {
+			if hasAuth || authInFlight || gotPassword {
 				continue
 			}
 
@@ -153,40 +359,23 @@ func (ws *WebSSH) server() error {
 			//ws.logger.Printf("(%s) auth with password %s", ws.id, password)
 			ws.logger.Printf("(%s) auth with password ******", ws.id)
 			config.Auth = append(config.Auth, ssh.Password(password))
-			session, err = ws.newSSHXtermSession(ws.sshConn, &config, msg)
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("password login error\r\n")})
-				return errors.Wrap(err, "password login error")
+			gotPassword = true
+			if !kbdAdded {
+				config.Auth = append(config.Auth, ssh.KeyboardInteractiveChallenge(ws.keyboardInteractiveChallenge))
+				kbdAdded = true
 			}
-			defer func() {
-				_ = session.Close()
-			}()
 
-			stdin, err = session.StdinPipe()
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("get stdin channel error\r\n")})
-				return errors.Wrap(err, "get stdin channel error")
+			// publickey 已经到齐就立即拨号，否则等一个短窗口看它是否随后到达，
+			// 以便两者合并进同一次握手
+			authMsg = msg
+			if gotPublickey {
+				resetAuthTimer(0)
+			} else {
+				resetAuthTimer(authCombineWindow)
 			}
-			defer func() {
-				_ = stdin.Close()
-			}()
-
-			err = ws.transformOutput(session, ws.websocket)
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("get stdin & stderr channel error\r\n")})
-				return errors.Wrap(err, "get stdin & stderr channel error")
-			}
-
-			err = session.Shell()
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("start a login shell error\r\n")})
-				return errors.Wrap(err, "start a login shell error")
-			}
-
-			hasAuth = true
 
 		case messageTypePublickey:
-			if hasAuth {
+			if hasAuth || authInFlight || gotPublickey {
 				continue
 			}
 
@@ -200,63 +389,83 @@ func (ws *WebSSH) server() error {
 				continue
 			}
 
-			//pemBytes, err := ioutil.ReadFile("/location/to/YOUR.pem")
-			//if err != nil {
-			//	return errors.Wrap(err, "publickey")
-			//}
-
-			// 传过来的 Data 是经过 url 编码的
-			pemStrings, _ := url.QueryUnescape(string(msg.Data))
-			//ws.logger.Printf("(%s) auth with privatekey %s", ws.id, pemStrings)
-			ws.logger.Printf("(%s) auth with privatekey ******", ws.id)
-			pemBytes := []byte(pemStrings)
-
-			signer, err := ssh.ParsePrivateKey(pemBytes)
+			// 传过来的 Data 是经过 url 编码的 JSON 数组，元素为 {pem, passphrase}，支持多把私钥
+			raw, _ := url.QueryUnescape(string(msg.Data))
+			creds, err := parsePublickeyCredentials([]byte(raw))
 			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("parse publickey erro\r\n")})
-				return errors.Wrap(err,"parse publickey error")
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("parse publickey error\r\n")})
+				return errors.Wrap(err, "parse publickey error")
 			}
-
-			config.Auth = append(config.Auth, ssh.PublicKeys(signer))
-			session, err = ws.newSSHXtermSession(ws.sshConn, &config, msg)
+			signers, err := signersFromCredentials(creds)
 			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("publickey login error\r\n")})
-				return errors.Wrap(err, "publickey login error")
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("parse publickey error\r\n")})
+				return errors.Wrap(err, "parse publickey error")
+			}
+			ws.logger.Printf("(%s) auth with %d privatekey(s)", ws.id, len(signers))
+			ws.publickeyCreds = creds
+
+			config.Auth = append(config.Auth, ssh.PublicKeys(signers...))
+			gotPublickey = true
+			if !kbdAdded {
+				config.Auth = append(config.Auth, ssh.KeyboardInteractiveChallenge(ws.keyboardInteractiveChallenge))
+				kbdAdded = true
 			}
-			defer func() {
-				_ = session.Close()
-			}()
 
-			stdin, err = session.StdinPipe()
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("get stdin channel error\r\n")})
-				return errors.Wrap(err, "get stdin channel error")
+			// password 已经到齐就立即拨号，否则等一个短窗口看它是否随后到达，
+			// 以便两者合并进同一次握手
+			authMsg = msg
+			if gotPassword {
+				resetAuthTimer(0)
+			} else {
+				resetAuthTimer(authCombineWindow)
 			}
-			defer func() {
-				_ = stdin.Close()
-			}()
 
-			err = ws.transformOutput(session, ws.websocket)
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("get stdin & stderr channel error\r\n")})
-				return errors.Wrap(err, "get stdin & stderr channel error")
+		case messageTypeKbdResponse:
+			var answers []string
+			if err := json.Unmarshal(msg.Data, &answers); err != nil {
+				ws.logger.Printf("(%s) invalid keyboard-interactive response: %v", ws.id, err)
+				continue
 			}
-			err = session.Shell()
-			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("start a login shell error\r\n")})
-				return errors.Wrap(err, "start a login shell error")
+			select {
+			case ws.kbdAnswers <- answers:
+			default:
+				ws.logger.Printf("(%s) keyboard-interactive response dropped, no pending challenge", ws.id)
 			}
 
-			hasAuth = true
+		case messageTypeHostKeyConfirm:
+			accept := string(msg.Data) == "accept"
+			select {
+			case ws.hostKeyConfirm <- accept:
+			default:
+				ws.logger.Printf("(%s) host key confirm dropped, no pending challenge", ws.id)
+			}
 
 		case messageTypeStdin:
 			if stdin == nil {
 				ws.logger.Printf("stdin wait login")
 				continue
 			}
-			_, err = stdin.Write(msg.Data)
+			if ws.inputLimiter != nil && !ws.inputLimiter.Allow(len(msg.Data)) {
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("\r\n[input rate limit exceeded]\r\n")})
+				continue
+			}
+			err = ws.guardStdin(msg.Data, stdin)
 			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("write to stdin error\r\n")})
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("write to stdin error\r\n")})
+				return errors.Wrap(err, "write to stdin error")
+			}
+			ws.recorder.writeEvent("i", string(msg.Data))
+			ws.metrics.AddBytesIn(int64(len(msg.Data)))
+			if ws.hooks.OnData != nil {
+				ws.hooks.OnData(ws.id, "in", len(msg.Data))
+			}
+
+		case messageTypeGuardConfirm:
+			if stdin == nil {
+				continue
+			}
+			if err = ws.resolveGuardConfirm(string(msg.Data), stdin); err != nil {
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("write to stdin error\r\n")})
 				return errors.Wrap(err, "write to stdin error")
 			}
 
@@ -267,9 +476,30 @@ func (ws *WebSSH) server() error {
 			}
 			err = session.WindowChange(msg.Rows, msg.Cols)
 			if err != nil {
-				_ = ws.websocket.WriteJSON(&message{Type: messageTypeStderr, Data: []byte("resize error\r\n")})
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("resize error\r\n")})
 				return errors.Wrap(err, "resize error")
 			}
+			ws.recorder.recordResize(msg.Cols, msg.Rows)
+			if ws.hooks.OnResize != nil {
+				ws.hooks.OnResize(ws.id, msg.Cols, msg.Rows)
+			}
+
+		case messageTypeSftpList, messageTypeSftpStat, messageTypeSftpMkdir, messageTypeSftpRm,
+			messageTypeSftpRename, messageTypeSftpUploadInit, messageTypeSftpUploadChunk,
+			messageTypeSftpUploadEnd, messageTypeSftpDownloadReq:
+			if ws.sshClient == nil {
+				ws.logger.Printf("sftp wait ssh client")
+				continue
+			}
+			if err = ws.newSftpClient(); err != nil {
+				ws.logger.Printf("(%s) %v", ws.id, err)
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte("sftp client error\r\n")})
+				continue
+			}
+			if err = ws.handleSftp(msg); err != nil {
+				ws.logger.Printf("(%s) %v", ws.id, err)
+				_ = ws.sendMessage(&message{Type: messageTypeStderr, Data: []byte(err.Error() + "\r\n")})
+			}
 		}
 	}
 }
@@ -281,7 +511,9 @@ func (ws *WebSSH) newSSHXtermSession(conn net.Conn, config *ssh.ClientConfig, ms
 	if err != nil {
 		return nil, errors.Wrap(err, "open client error")
 	}
-	session, err := ssh.NewClient(c, chans, reqs).NewSession()
+	client := ssh.NewClient(c, chans, reqs)
+	ws.sshClient = client
+	session, err := client.NewSession()
 	if err != nil {
 		return nil, errors.Wrap(err, "open session error")
 	}
@@ -296,6 +528,7 @@ func (ws *WebSSH) newSSHXtermSession(conn net.Conn, config *ssh.ClientConfig, ms
 	if err != nil {
 		return nil, errors.Wrap(err, "open pty error")
 	}
+	ws.recorder.setSize(msg.Cols, msg.Rows)
 	return session, nil
 }
 
@@ -309,20 +542,27 @@ func (ws *WebSSH) transformOutput(session *ssh.Session, conn *websocket.Conn) er
 	if err != nil {
 		return errors.Wrap(err, "get stderr channel error")
 	}
-	copyToMessage := func(t messageType, r io.Reader) {
+	copyToMessage := func(t messageType, r io.Reader, record bool) {
 		buff := make([]byte, ws.buffSize)
 		for {
 			n, err := r.Read(buff)
 			if err != nil {
 				return
 			}
-			err = conn.WriteJSON(&message{Type: t, Data: buff[:n]})
+			if record {
+				ws.recorder.writeEvent("o", string(buff[:n]))
+			}
+			ws.metrics.AddBytesOut(int64(n))
+			if ws.hooks.OnData != nil {
+				ws.hooks.OnData(ws.id, "out", n)
+			}
+			err = ws.sendMessage(&message{Type: t, Data: buff[:n]})
 			if err != nil {
 				return
 			}
 		}
 	}
-	go copyToMessage(messageTypeStdout, stdout)
-	go copyToMessage(messageTypeStderr, stderr)
+	go copyToMessage(messageTypeStdout, stdout, true)
+	go copyToMessage(messageTypeStderr, stderr, false)
 	return nil
 }
\ No newline at end of file